@@ -0,0 +1,32 @@
+package configuration
+
+// OAuth holds the configuration for third-party sign-in. This is embedded
+// as a field on the top level Configuration struct. A provider is only
+// exposed on `/authentication/oauth` when its own Enabled flag is set,
+// so self-hosters can turn on exactly the providers they have credentials
+// for.
+type OAuth struct {
+	Google OAuthGoogle `yaml:"google"`
+	GitHub OAuthGitHub `yaml:"github"`
+	Apple  OAuthApple  `yaml:"apple"`
+}
+
+type OAuthGoogle struct {
+	Enabled      bool   `yaml:"enabled"`
+	ClientId     string `yaml:"clientId"`
+	ClientSecret string `yaml:"clientSecret"`
+}
+
+type OAuthGitHub struct {
+	Enabled      bool   `yaml:"enabled"`
+	ClientId     string `yaml:"clientId"`
+	ClientSecret string `yaml:"clientSecret"`
+}
+
+type OAuthApple struct {
+	Enabled    bool   `yaml:"enabled"`
+	ClientId   string `yaml:"clientId"`
+	TeamId     string `yaml:"teamId"`
+	KeyId      string `yaml:"keyId"`
+	PrivateKey string `yaml:"privateKey"`
+}
@@ -0,0 +1,21 @@
+package configuration
+
+import "time"
+
+// RateLimit controls the brute-force login defenses in pkg/security. A zero
+// value for any field falls back to security.DefaultLockoutPolicy.
+type RateLimit struct {
+	// MaxFailures is how many consecutive failures a (email, IP) pair is
+	// allowed before it is locked out entirely.
+	MaxFailures int `yaml:"maxFailures"`
+
+	// LockDuration is how long a pair stays locked out once MaxFailures is
+	// reached.
+	LockDuration time.Duration `yaml:"lockDuration"`
+
+	// RequireCaptchaAfter is how many failures must accumulate before a
+	// captcha is required on the pair's next attempt, independent of
+	// whether captcha is otherwise always required. One means "after the
+	// first failure".
+	RequireCaptchaAfter int `yaml:"requireCaptchaAfter"`
+}
@@ -0,0 +1,9 @@
+package configuration
+
+// Security holds cross-cutting secrets that protect data at rest rather
+// than in transit, such as the key used to encrypt TOTP seeds.
+type Security struct {
+	// EncryptionKey must be exactly 32 bytes (AES-256). Rotating it requires
+	// re-encrypting every row that depends on it.
+	EncryptionKey string `yaml:"encryptionKey"`
+}
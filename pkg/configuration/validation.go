@@ -0,0 +1,17 @@
+package configuration
+
+// Validation controls the server-side password strength (zxcvbn) and
+// breach-list checks applied when a password is chosen via
+// changePasswordEndpoint. loginEndpoint only checks email format and a bare
+// length floor, since re-validating an existing password against a policy
+// it predates would lock the login out with no way back in.
+type Validation struct {
+	// MinPasswordScore is the minimum acceptable zxcvbn score (0-4). Zero
+	// value falls back to validation.DefaultMinPasswordScore.
+	MinPasswordScore int `yaml:"minPasswordScore"`
+
+	// BreachedPasswordsPath points at a newline-delimited, locally shipped
+	// list of known-breached passwords (e.g. the HIBP top-N list). Empty
+	// disables the breached-password check entirely.
+	BreachedPasswordsPath string `yaml:"breachedPasswordsPath"`
+}
@@ -5,10 +5,13 @@ import (
 	"github.com/form3tech-oss/jwt-go"
 	"github.com/getsentry/sentry-go"
 	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
 	"github.com/kataras/iris/v12"
 	"github.com/monetrapp/rest-api/pkg/hash"
 	"github.com/monetrapp/rest-api/pkg/models"
 	"github.com/monetrapp/rest-api/pkg/repository"
+	"github.com/monetrapp/rest-api/pkg/security"
+	"github.com/monetrapp/rest-api/pkg/validation"
 	"github.com/pkg/errors"
 	"github.com/stripe/stripe-go/v72"
 	"net/http"
@@ -16,11 +19,18 @@ import (
 	"time"
 )
 
+// errInvalidCredentials is returned from inside the login transaction on a
+// password mismatch so it can be distinguished from pg.ErrNoRows and from
+// unexpected database errors, all of which map to the same "invalid email
+// and password" response.
+var errInvalidCredentials = errors.New("invalid email and password")
+
 type HarderClaims struct {
 	LoginId            uint64 `json:"loginId"`
 	UserId             uint64 `json:"userId"`
 	AccountId          uint64 `json:"accountId"`
 	SubscriptionStatus bool   `json:"subStatus"`
+	DeviceId           string `json:"deviceId"`
 	jwt.StandardClaims
 }
 
@@ -42,39 +52,92 @@ func (c *Controller) loginEndpoint(ctx iris.Context) {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 		Captcha  string `json:"captcha"`
+		DeviceId string `json:"deviceId"`
 	}
 	if err := ctx.ReadJSON(&loginRequest); err != nil {
 		c.wrapAndReturnError(ctx, err, http.StatusBadRequest, "failed to decode login request")
 		return
 	}
 
+	loginRequest.Email = strings.ToLower(strings.TrimSpace(loginRequest.Email))
+	loginRequest.Password = strings.TrimSpace(loginRequest.Password)
+	ipAddress := ctx.RemoteAddr()
+
+	// This is checked before anything else, including the captcha and the
+	// database lookup, so that a locked-out (email, IP) pair always gets
+	// the same fast, uniform response regardless of whether the email
+	// exists.
+	allowed, requireCaptcha, err := c.rateLimiter.Check(c.getContext(ctx), loginRequest.Email, ipAddress)
+	if err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to authenticate")
+		return
+	}
+	if !allowed {
+		c.returnError(ctx, http.StatusTooManyRequests, "too many failed login attempts, please try again later")
+		return
+	}
+
 	// This will take the captcha from the request and validate it if the API is
-	// configured to do so. If it is enabled and the captcha fails then an error
-	// is returned to the client.
+	// configured to do so. If this (email, IP) pair has recently failed enough
+	// times, a captcha must also be present even when the API is not
+	// configured to validate one; in that case only its presence is checked,
+	// it is not verified. If a required captcha is missing or fails
+	// validation then an error is returned to the client.
+	if requireCaptcha && strings.TrimSpace(loginRequest.Captcha) == "" {
+		c.returnError(ctx, http.StatusBadRequest, "valid ReCAPTCHA is required")
+		return
+	}
 	if err := c.validateCaptchaMaybe(c.getContext(ctx), loginRequest.Captcha); err != nil {
 		c.wrapAndReturnError(ctx, err, http.StatusBadRequest, "valid ReCAPTCHA is required")
 		return
 	}
 
-	loginRequest.Email = strings.ToLower(strings.TrimSpace(loginRequest.Email))
-	loginRequest.Password = strings.TrimSpace(loginRequest.Password)
-
 	if err := c.validateLogin(loginRequest.Email, loginRequest.Password); err != nil {
-		c.wrapAndReturnError(ctx, err, http.StatusBadRequest, "login is not valid")
+		c.returnValidationError(ctx, err)
 		return
 	}
 
-	hashedPassword := hash.HashPassword(loginRequest.Email, loginRequest.Password)
 	var login models.Login
 	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
-		return txn.ModelContext(c.getContext(ctx), &login).
+		if err := txn.ModelContext(c.getContext(ctx), &login).
 			Relation("Users").
 			Relation("Users.Account").
-			Where(`"login"."email" = ? AND "login"."password_hash" = ?`, loginRequest.Email, hashedPassword).
+			Where(`"login"."email" = ?`, loginRequest.Email).
 			Limit(1).
-			Select(&login)
+			Select(&login); err != nil {
+			return err
+		}
+
+		if !hash.Verify(hash.Algorithm(login.PasswordAlgo), loginRequest.Email, loginRequest.Password, login.PasswordHash) {
+			return errInvalidCredentials
+		}
+
+		// The password matched under a legacy algorithm, or under the current
+		// algorithm but stale parameters (e.g. an older bcrypt cost);
+		// transparently rehash it now, while we still have the plaintext,
+		// rather than requiring a separate offline migration.
+		if hash.Algorithm(login.PasswordAlgo) != hash.CurrentAlgorithm || login.PasswordVersion < hash.CurrentVersion {
+			newHash, newAlgo, err := hash.Hash(loginRequest.Password)
+			if err != nil {
+				return err
+			}
+
+			login.PasswordHash = newHash
+			login.PasswordAlgo = string(newAlgo)
+			login.PasswordVersion = hash.CurrentVersion
+
+			if _, err := txn.ModelContext(c.getContext(ctx), &login).
+				Column("password_hash", "password_algo", "password_version").
+				WherePK().
+				Update(); err != nil {
+				return err
+			}
+		}
+
+		return nil
 	}); err != nil {
-		if err == pg.ErrNoRows {
+		if err == pg.ErrNoRows || err == errInvalidCredentials {
+			c.recordLoginFailure(ctx, loginRequest.Email, ipAddress)
 			c.returnError(ctx, http.StatusForbidden, "invalid email and password")
 			return
 		}
@@ -83,6 +146,37 @@ func (c *Controller) loginEndpoint(ctx iris.Context) {
 		return
 	}
 
+	if err := c.rateLimiter.Reset(c.getContext(ctx), loginRequest.Email, ipAddress); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to authenticate")
+		return
+	}
+
+	var totpEnabled bool
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		var err error
+		totpEnabled, err = c.loginTotpEnabled(txn, c.getContext(ctx), login.LoginId)
+		return err
+	}); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to check mfa status")
+		return
+	}
+
+	if totpEnabled {
+		mfaToken, err := c.generateMfaPendingToken(login.LoginId)
+		if err != nil {
+			c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "could not generate JWT")
+			return
+		}
+
+		c.recordAuthEvent(ctx, &login.LoginId, loginRequest.Email, models.AuditEventMfaChallenge, ipAddress)
+
+		ctx.JSON(map[string]interface{}{
+			"mfaPending": true,
+			"token":      mfaToken,
+		})
+		return
+	}
+
 	switch len(login.Users) {
 	case 0:
 		// TODO (elliotcourant) Should we allow them to create an account?
@@ -92,15 +186,13 @@ func (c *Controller) loginEndpoint(ctx iris.Context) {
 		user := login.Users[0]
 
 		if !c.configuration.Stripe.BillingEnabled {
-			token, err := c.generateToken(login.LoginId, user.UserId, user.AccountId, true)
+			tokens, err := c.issueTokenPair(ctx, login.LoginId, user.UserId, user.AccountId, true, loginRequest.DeviceId)
 			if err != nil {
 				c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "could not generate JWT")
 				return
 			}
 			// Return their account token.
-			ctx.JSON(map[string]interface{}{
-				"token": token,
-			})
+			ctx.JSON(tokens)
 			return
 		}
 
@@ -132,59 +224,149 @@ func (c *Controller) loginEndpoint(ctx iris.Context) {
 			}
 		}
 
-		token, err := c.generateToken(login.LoginId, user.UserId, user.AccountId, subscriptionIsActive)
+		tokens, err := c.issueTokenPair(ctx, login.LoginId, user.UserId, user.AccountId, subscriptionIsActive, loginRequest.DeviceId)
 		if err != nil {
 			c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "could not generate JWT")
 			return
 		}
 
-		result := map[string]interface{}{
-			"token": token,
-		}
-
 		if !subscriptionIsActive {
-			result["nextUrl"] = "/account/subscribe"
+			tokens["nextUrl"] = "/account/subscribe"
 		}
 
-		ctx.JSON(result)
+		ctx.JSON(tokens)
 	default:
 		// If the login has more than one user then we want to generate a temp
 		// JWT that will only grant them access to API endpoints not specific to
 		// an account.
-		token, err := c.generateToken(login.LoginId, 0, 0, true)
+		tokens, err := c.issueTokenPair(ctx, login.LoginId, 0, 0, true, loginRequest.DeviceId)
 		if err != nil {
 			c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "could not generate JWT")
 			return
 		}
 
-		ctx.JSON(map[string]interface{}{
-			"token": token,
-			"users": login.Users,
-		})
+		tokens["users"] = login.Users
+		ctx.JSON(tokens)
 	}
 }
 
+// validateLogin only checks that the submitted credentials are well-formed
+// enough to look up and compare against the stored hash. It deliberately
+// does not run the zxcvbn strength check or the breach-list check: those
+// judge a password someone is choosing, not one they already set, and an
+// existing user's on-file password failing a policy that postdates it
+// would lock them out with no way back in. Those checks belong on
+// changePasswordEndpoint, where the caller is actually choosing a new
+// password.
 func (c *Controller) validateLogin(email, password string) error {
-	// TODO (elliotcourant) Add some email format validation here.
-	if len(password) < 8 {
-		return errors.New("password must be at least 8 characters")
+	if err := validation.ValidateEmail(email); err != nil {
+		return err
+	}
+
+	if len(password) < validation.MinPasswordLength {
+		return validation.Error{
+			Code:    validation.ErrorCodePasswordTooWeak,
+			Message: fmt.Sprintf("password must be at least %d characters", validation.MinPasswordLength),
+		}
 	}
 
 	return nil
 }
 
-func (c *Controller) generateToken(loginId, userId, accountId uint64, subscriptionActive bool) (string, error) {
+// returnValidationError surfaces a validation.Error's structured code to
+// the client so the frontend can localize the message instead of matching
+// on the English text; any other error falls back to the generic
+// "login is not valid" response.
+func (c *Controller) returnValidationError(ctx iris.Context, err error) {
+	if validationError, ok := err.(validation.Error); ok {
+		ctx.StatusCode(http.StatusBadRequest)
+		ctx.JSON(map[string]interface{}{
+			"error": validationError.Message,
+			"code":  validationError.Code,
+		})
+		return
+	}
+
+	c.wrapAndReturnError(ctx, err, http.StatusBadRequest, "login is not valid")
+}
+
+// recordLoginFailure feeds a failed login attempt into the rate limiter and
+// the audit log. Errors doing so are deliberately not surfaced to the
+// client: a logging failure should not change the "invalid email and
+// password" response the caller already got, and it is reported to Sentry
+// instead so it doesn't go unnoticed.
+func (c *Controller) recordLoginFailure(ctx iris.Context, email, ipAddress string) {
+	if err := c.rateLimiter.RecordFailure(c.getContext(ctx), email, ipAddress); err != nil {
+		sentry.CaptureException(err)
+	}
+
+	c.recordAuthEvent(ctx, nil, email, models.AuditEventLoginFailure, ipAddress)
+}
+
+// recordAuthEvent appends a row to the audit log. Like recordLoginFailure,
+// failures are reported to Sentry rather than surfaced to the client.
+func (c *Controller) recordAuthEvent(ctx iris.Context, loginId *uint64, email string, eventType models.AuditEventType, ipAddress string) {
+	event := models.AuditLog{
+		LoginId:   loginId,
+		Email:     email,
+		EventType: eventType,
+		IpAddress: ipAddress,
+		UserAgent: ctx.Request().UserAgent(),
+	}
+
+	if err := security.RecordAuditEvent(c.getContext(ctx), c.db, event); err != nil {
+		sentry.CaptureException(err)
+	}
+}
+
+// accessTokenLifetime is intentionally short: unlike the old 31-day JWT, an
+// access token that leaks is only useful to an attacker for a few minutes.
+// Long-lived sessions are carried by the refresh token instead.
+const accessTokenLifetime = 15 * time.Minute
+
+// issueTokenPair mints a fresh access JWT and a corresponding refresh token
+// for a successful login, returning both in the shape the login endpoints
+// already send back to the client.
+func (c *Controller) issueTokenPair(ctx iris.Context, loginId, userId, accountId uint64, subscriptionActive bool, deviceId string) (map[string]interface{}, error) {
+	if deviceId == "" {
+		deviceId = generateDeviceId()
+	}
+
+	accessToken, _, err := c.generateToken(loginId, userId, accountId, subscriptionActive, deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := c.issueRefreshToken(ctx, loginId, deviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordAuthEvent(ctx, &loginId, "", models.AuditEventLoginSuccess, ctx.RemoteAddr())
+
+	return map[string]interface{}{
+		"token":        accessToken,
+		"refreshToken": refreshToken,
+	}, nil
+}
+
+// generateToken mints a short-lived HarderClaims access JWT. It returns the
+// jti alongside the token so callers that need to revoke it later (e.g. on
+// logout) don't have to re-parse the token to get it.
+func (c *Controller) generateToken(loginId, userId, accountId uint64, subscriptionActive bool, deviceId string) (string, string, error) {
 	now := time.Now()
+	jti := uuid.New().String()
 	claims := &HarderClaims{
 		LoginId:   loginId,
 		UserId:    userId,
 		AccountId: accountId,
+		DeviceId:  deviceId,
 		StandardClaims: jwt.StandardClaims{
 			Audience: []string{
 				c.configuration.APIDomainName,
 			},
-			ExpiresAt: now.Add(31 * 24 * time.Hour).Unix(),
-			Id:        "",
+			ExpiresAt: now.Add(accessTokenLifetime).Unix(),
+			Id:        jti,
 			IssuedAt:  now.Unix(),
 			Issuer:    c.configuration.APIDomainName,
 			NotBefore: now.Unix(),
@@ -195,8 +377,8 @@ func (c *Controller) generateToken(loginId, userId, accountId uint64, subscripti
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signedToken, err := token.SignedString([]byte(c.configuration.JWT.LoginJwtSecret))
 	if err != nil {
-		return "", errors.Wrap(err, "failed to sign JWT")
+		return "", "", errors.Wrap(err, "failed to sign JWT")
 	}
 
-	return signedToken, nil
+	return signedToken, jti, nil
 }
@@ -0,0 +1,512 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/form3tech-oss/jwt-go"
+	"github.com/getsentry/sentry-go"
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/monetrapp/rest-api/pkg/models"
+	"github.com/monetrapp/rest-api/pkg/security"
+	"github.com/pquerna/otp/totp"
+)
+
+// mfaPendingAudience distinguishes an "mfa_pending" token, which only
+// proves the password check succeeded, from a real HarderClaims access
+// token, which grants API access.
+const mfaPendingAudience = "monetr:mfa-pending"
+
+// mfaPendingLifetime is short: the client is expected to immediately follow
+// up with the TOTP code.
+const mfaPendingLifetime = 5 * time.Minute
+
+// recoveryCodeCount is how many single-use backup codes are issued when a
+// login enrolls in TOTP.
+const recoveryCodeCount = 10
+
+// MfaPendingClaims is issued after a successful password check when the
+// login has TOTP enabled. It proves the password was correct but does not
+// grant API access until exchanged for a HarderClaims token via
+// /authentication/mfa/verify.
+type MfaPendingClaims struct {
+	LoginId uint64 `json:"loginId"`
+	jwt.StandardClaims
+}
+
+// mfaEnrollEndpoint begins TOTP enrollment for the caller's own login,
+// generating a new secret and a set of recovery codes. The login is not
+// actually protected by TOTP until the code is confirmed via
+// /authentication/mfa/verify.
+//
+// If TOTP is already enabled, this overwrites the existing secret and
+// recovery codes, so re-enrolling requires a valid current code first, the
+// same way mfaDisableEndpoint does; otherwise a stolen bearer token alone
+// would be enough to silently take over a victim's 2FA.
+// @Summary Enroll MFA
+// @id mfaEnroll
+// @tags Authentication
+// @description Begin TOTP enrollment for the authenticated login.
+// @Accept json
+// @Router /authentication/mfa/enroll [post]
+// @Success 200 {object} swag.MfaEnrollResponse
+// @Failure 401 {object} ApiError Authentication is required.
+// @Failure 403 {object} ApiError TOTP is already enabled and the current code is missing or invalid.
+func (c *Controller) mfaEnrollEndpoint(ctx iris.Context) {
+	claims := c.getAuthenticatedClaims(ctx)
+	if claims == nil {
+		c.returnError(ctx, http.StatusUnauthorized, "authentication is required")
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusBadRequest, "failed to decode mfa enroll request")
+		return
+	}
+
+	var alreadyEnabled bool
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		var err error
+		alreadyEnabled, err = c.loginTotpEnabled(txn, c.getContext(ctx), claims.LoginId)
+		return err
+	}); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to check mfa status")
+		return
+	}
+
+	if alreadyEnabled {
+		valid, err := c.verifyTotpCode(c.getContext(ctx), claims.LoginId, request.Code)
+		if err != nil {
+			c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to verify totp code")
+			return
+		}
+		if !valid {
+			c.returnError(ctx, http.StatusForbidden, "invalid code")
+			return
+		}
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      "monetr",
+		AccountName: fmt.Sprintf("login-%d", claims.LoginId),
+	})
+	if err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to generate totp secret")
+		return
+	}
+
+	encryptedSecret, err := security.Encrypt([]byte(c.configuration.Security.EncryptionKey), []byte(key.Secret()))
+	if err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to encrypt totp secret")
+		return
+	}
+
+	recoveryCodes := generateRecoveryCodes(recoveryCodeCount)
+
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		userTotp := models.UserTotp{
+			LoginId:         claims.LoginId,
+			EncryptedSecret: encryptedSecret,
+			Enabled:         false,
+		}
+		if _, err := txn.ModelContext(c.getContext(ctx), &userTotp).
+			OnConflict("(login_id) DO UPDATE").
+			Insert(); err != nil {
+			return err
+		}
+
+		// Replace any previously issued, unused recovery codes with a fresh
+		// set so an old set can't be combined with a new secret.
+		if _, err := txn.ModelContext(c.getContext(ctx), (*models.RecoveryCode)(nil)).
+			Where(`"recovery_code"."login_id" = ?`, claims.LoginId).
+			Delete(); err != nil {
+			return err
+		}
+
+		for _, code := range recoveryCodes {
+			recoveryCode := models.RecoveryCode{
+				LoginId:  claims.LoginId,
+				CodeHash: hashRecoveryCode(code),
+			}
+			if _, err := txn.ModelContext(c.getContext(ctx), &recoveryCode).Insert(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		c.wrapPgError(ctx, err, "failed to save totp enrollment")
+		return
+	}
+
+	ctx.JSON(map[string]interface{}{
+		"otpauthUrl":    key.URL(),
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+// mfaVerifyEndpoint serves two purposes depending on the caller's state:
+// confirming a just-started enrollment (flips UserTotp.Enabled to true), or
+// completing a login that was interrupted by an mfa_pending challenge
+// (mints the real HarderClaims token pair).
+// @Summary Verify MFA
+// @id mfaVerify
+// @tags Authentication
+// @description Verify a TOTP code to complete enrollment or a pending login.
+// @Accept json
+// @Produce json
+// @Router /authentication/mfa/verify [post]
+// @Success 200 {object} swag.LoginResponse
+// @Failure 403 {object} ApiError Code is invalid or expired.
+func (c *Controller) mfaVerifyEndpoint(ctx iris.Context) {
+	var request struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+		DeviceId     string `json:"deviceId"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusBadRequest, "failed to decode mfa verify request")
+		return
+	}
+
+	if pending := c.getMfaPendingClaims(ctx); pending != nil {
+		c.completePendingLogin(ctx, pending.LoginId, request.Code, request.RecoveryCode, request.DeviceId)
+		return
+	}
+
+	claims := c.getAuthenticatedClaims(ctx)
+	if claims == nil {
+		c.returnError(ctx, http.StatusUnauthorized, "authentication is required")
+		return
+	}
+
+	if ok, err := c.checkMfaRateLimit(ctx, claims.LoginId); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to verify totp code")
+		return
+	} else if !ok {
+		c.returnError(ctx, http.StatusTooManyRequests, "too many failed attempts, please try again later")
+		return
+	}
+
+	valid, err := c.verifyTotpCode(c.getContext(ctx), claims.LoginId, request.Code)
+	if err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to verify totp code")
+		return
+	}
+	if !valid {
+		c.recordMfaFailure(ctx, claims.LoginId)
+		c.returnError(ctx, http.StatusForbidden, "invalid code")
+		return
+	}
+
+	if err := c.rateLimiter.Reset(c.getContext(ctx), mfaRateLimitKey(claims.LoginId), ctx.RemoteAddr()); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to verify totp code")
+		return
+	}
+
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		_, err := txn.ModelContext(c.getContext(ctx), (*models.UserTotp)(nil)).
+			Set("enabled = ?", true).
+			Where(`"user_totp"."login_id" = ?`, claims.LoginId).
+			Update()
+		return err
+	}); err != nil {
+		c.wrapPgError(ctx, err, "failed to enable totp")
+		return
+	}
+
+	ctx.JSON(map[string]interface{}{
+		"enabled": true,
+	})
+}
+
+// completePendingLogin finishes a login that was interrupted by an
+// mfa_pending challenge, issuing the same token pair the password flow
+// would have if TOTP were not enabled.
+func (c *Controller) completePendingLogin(ctx iris.Context, loginId uint64, code, recoveryCode, deviceId string) {
+	var login models.Login
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		return txn.ModelContext(c.getContext(ctx), &login).
+			Relation("Users").
+			Where(`"login"."login_id" = ?`, loginId).
+			Limit(1).
+			Select(&login)
+	}); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to load login")
+		return
+	}
+
+	if ok, err := c.checkMfaRateLimit(ctx, loginId); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to verify code")
+		return
+	} else if !ok {
+		c.returnError(ctx, http.StatusTooManyRequests, "too many failed attempts, please try again later")
+		return
+	}
+
+	var authenticated bool
+	if recoveryCode != "" {
+		ok, err := c.consumeRecoveryCode(c.getContext(ctx), loginId, recoveryCode)
+		if err != nil {
+			c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to verify recovery code")
+			return
+		}
+		authenticated = ok
+	} else {
+		ok, err := c.verifyTotpCode(c.getContext(ctx), loginId, code)
+		if err != nil {
+			c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to verify totp code")
+			return
+		}
+		authenticated = ok
+	}
+
+	if !authenticated {
+		c.recordMfaFailure(ctx, loginId)
+		c.returnError(ctx, http.StatusForbidden, "invalid code")
+		return
+	}
+
+	var userId, accountId uint64
+	if len(login.Users) == 1 {
+		userId = login.Users[0].UserId
+		accountId = login.Users[0].AccountId
+	}
+
+	if err := c.rateLimiter.Reset(c.getContext(ctx), mfaRateLimitKey(loginId), ctx.RemoteAddr()); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to authenticate")
+		return
+	}
+
+	tokens, err := c.issueTokenPair(ctx, login.LoginId, userId, accountId, true, deviceId)
+	if err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "could not generate JWT")
+		return
+	}
+
+	if len(login.Users) != 1 {
+		tokens["users"] = login.Users
+	}
+
+	ctx.JSON(tokens)
+}
+
+// mfaRateLimitKey lets completePendingLogin and mfaVerifyEndpoint reuse
+// RateLimiter, which is keyed on (email, ip), for a TOTP/recovery code
+// attempt instead of a password attempt; prefixing loginId keeps it from
+// ever colliding with a real email.
+func mfaRateLimitKey(loginId uint64) string {
+	return fmt.Sprintf("mfa:%d", loginId)
+}
+
+// checkMfaRateLimit guards a TOTP or recovery code attempt the same way
+// loginEndpoint guards a password attempt, so an attacker holding a valid
+// password or a captured mfa_pending token can't brute-force the 6-digit
+// code or the 10 recovery codes with no backoff.
+func (c *Controller) checkMfaRateLimit(ctx iris.Context, loginId uint64) (bool, error) {
+	allowed, _, err := c.rateLimiter.Check(c.getContext(ctx), mfaRateLimitKey(loginId), ctx.RemoteAddr())
+	return allowed, err
+}
+
+// recordMfaFailure feeds a failed TOTP/recovery code attempt into the same
+// rate limiter loginEndpoint uses for failed passwords.
+func (c *Controller) recordMfaFailure(ctx iris.Context, loginId uint64) {
+	if err := c.rateLimiter.RecordFailure(c.getContext(ctx), mfaRateLimitKey(loginId), ctx.RemoteAddr()); err != nil {
+		sentry.CaptureException(err)
+	}
+}
+
+// mfaDisableEndpoint removes TOTP protection from the caller's login after
+// confirming one more valid code, so a stolen session token alone can't
+// disable it.
+// @Summary Disable MFA
+// @id mfaDisable
+// @tags Authentication
+// @description Disable TOTP for the authenticated login.
+// @Accept json
+// @Router /authentication/mfa/disable [post]
+// @Success 204
+// @Failure 403 {object} ApiError Code is invalid.
+func (c *Controller) mfaDisableEndpoint(ctx iris.Context) {
+	claims := c.getAuthenticatedClaims(ctx)
+	if claims == nil {
+		c.returnError(ctx, http.StatusUnauthorized, "authentication is required")
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusBadRequest, "failed to decode mfa disable request")
+		return
+	}
+
+	valid, err := c.verifyTotpCode(c.getContext(ctx), claims.LoginId, request.Code)
+	if err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to verify totp code")
+		return
+	}
+	if !valid {
+		c.returnError(ctx, http.StatusForbidden, "invalid code")
+		return
+	}
+
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		if _, err := txn.ModelContext(c.getContext(ctx), (*models.UserTotp)(nil)).
+			Where(`"user_totp"."login_id" = ?`, claims.LoginId).
+			Delete(); err != nil {
+			return err
+		}
+
+		_, err := txn.ModelContext(c.getContext(ctx), (*models.RecoveryCode)(nil)).
+			Where(`"recovery_code"."login_id" = ?`, claims.LoginId).
+			Delete()
+		return err
+	}); err != nil {
+		c.wrapPgError(ctx, err, "failed to disable totp")
+		return
+	}
+
+	ctx.StatusCode(http.StatusNoContent)
+}
+
+// loginTotpEnabled reports whether a login has completed TOTP enrollment,
+// for loginEndpoint to decide whether to challenge for a code instead of
+// issuing a real token pair.
+func (c *Controller) loginTotpEnabled(txn *pg.Tx, goCtx context.Context, loginId uint64) (bool, error) {
+	var userTotp models.UserTotp
+	err := txn.ModelContext(goCtx, &userTotp).
+		Where(`"user_totp"."login_id" = ? AND "user_totp"."enabled" = true`, loginId).
+		Limit(1).
+		Select(&userTotp)
+	if err == pg.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// verifyTotpCode decrypts the login's stored secret and checks the supplied
+// 6-digit code against it.
+func (c *Controller) verifyTotpCode(goCtx context.Context, loginId uint64, code string) (bool, error) {
+	if code == "" {
+		return false, nil
+	}
+
+	var userTotp models.UserTotp
+	if err := c.db.RunInTransaction(goCtx, func(txn *pg.Tx) error {
+		return txn.ModelContext(goCtx, &userTotp).
+			Where(`"user_totp"."login_id" = ?`, loginId).
+			Limit(1).
+			Select(&userTotp)
+	}); err != nil {
+		if err == pg.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	secret, err := security.Decrypt([]byte(c.configuration.Security.EncryptionKey), userTotp.EncryptedSecret)
+	if err != nil {
+		return false, err
+	}
+
+	return totp.Validate(code, string(secret)), nil
+}
+
+// consumeRecoveryCode checks a submitted recovery code against the login's
+// unused codes and, if it matches, marks it used so it cannot be replayed.
+func (c *Controller) consumeRecoveryCode(goCtx context.Context, loginId uint64, code string) (bool, error) {
+	if code == "" {
+		return false, nil
+	}
+
+	hashed := hashRecoveryCode(code)
+	var consumed bool
+	if err := c.db.RunInTransaction(goCtx, func(txn *pg.Tx) error {
+		result, err := txn.ModelContext(goCtx, (*models.RecoveryCode)(nil)).
+			Set("used_at = now()").
+			Where(`"recovery_code"."login_id" = ? AND "recovery_code"."code_hash" = ? AND "recovery_code"."used_at" IS NULL`, loginId, hashed).
+			Update()
+		if err != nil {
+			return err
+		}
+		consumed = result.RowsAffected() == 1
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	return consumed, nil
+}
+
+// generateMfaPendingToken mints the short-lived token returned in place of
+// a real access token when a login has TOTP enabled.
+func (c *Controller) generateMfaPendingToken(loginId uint64) (string, error) {
+	now := time.Now()
+	claims := &MfaPendingClaims{
+		LoginId: loginId,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  []string{mfaPendingAudience},
+			ExpiresAt: now.Add(mfaPendingLifetime).Unix(),
+			IssuedAt:  now.Unix(),
+			Issuer:    c.configuration.APIDomainName,
+			NotBefore: now.Unix(),
+			Subject:   "monetr",
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(c.configuration.JWT.LoginJwtSecret))
+}
+
+// getMfaPendingClaims parses an mfa_pending token from the Authorization
+// header, returning nil if none is present or it does not validate.
+func (c *Controller) getMfaPendingClaims(ctx iris.Context) *MfaPendingClaims {
+	raw := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	if raw == "" {
+		return nil
+	}
+
+	var claims MfaPendingClaims
+	token, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(c.configuration.JWT.LoginJwtSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil
+	}
+
+	for _, audience := range claims.Audience {
+		if audience == mfaPendingAudience {
+			return &claims
+		}
+	}
+
+	return nil
+}
+
+func generateRecoveryCodes(count int) []string {
+	codes := make([]string, count)
+	for i := range codes {
+		buffer := make([]byte, 5)
+		_, _ = rand.Read(buffer)
+		codes[i] = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buffer)
+	}
+	return codes
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(code)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,315 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/monetrapp/rest-api/pkg/models"
+	"github.com/monetrapp/rest-api/pkg/oauth"
+	"github.com/pkg/errors"
+)
+
+// oauthStateCookieName carries the signed OAuth state between the login
+// redirect and the provider's callback. It is short-lived and HTTP-only.
+const oauthStateCookieName = "monetr.oauth.state"
+
+// oauthStateTTL bounds how long a sign-in attempt has to complete the
+// provider's consent flow before the state token is rejected as stale.
+const oauthStateTTL = 10 * time.Minute
+
+// oauthState is the payload signed into the state cookie. LoginId is only
+// populated for an account-linking request made by an already authenticated
+// user; it is zero for a fresh sign-in.
+type oauthState struct {
+	Nonce     string `json:"nonce"`
+	LoginId   uint64 `json:"loginId,omitempty"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// oauthProviders returns the set of OAuth/OIDC providers enabled for this
+// deployment, keyed by their Name(). Self-hosters opt into each provider
+// independently via configuration.
+func (c *Controller) oauthProviders() map[string]oauth.AuthProvider {
+	providers := map[string]oauth.AuthProvider{}
+
+	redirect := func(provider string) string {
+		return strings.TrimRight(c.configuration.APIDomainName, "/") + "/authentication/oauth/" + provider + "/callback"
+	}
+
+	if google := c.configuration.OAuth.Google; google.Enabled {
+		providers["google"] = oauth.NewGoogleProvider(google.ClientId, google.ClientSecret, redirect("google"))
+	}
+
+	if github := c.configuration.OAuth.GitHub; github.Enabled {
+		providers["github"] = oauth.NewGitHubProvider(github.ClientId, github.ClientSecret, redirect("github"))
+	}
+
+	if apple := c.configuration.OAuth.Apple; apple.Enabled {
+		providers["apple"] = oauth.NewAppleProvider(apple.ClientId, apple.TeamId, apple.KeyId, []byte(apple.PrivateKey), redirect("apple"))
+	}
+
+	return providers
+}
+
+// oauthLoginEndpoint begins a third-party sign-in by redirecting the client
+// to the requested provider's consent screen.
+// @Summary OAuth Login
+// @id oauthLogin
+// @tags Authentication
+// @description Begin sign-in with a third-party identity provider.
+// @Param provider path string true "Provider name, e.g. google, github, apple"
+// @Router /authentication/oauth/{provider}/login [get]
+// @Success 302
+// @Failure 404 {object} ApiError Unknown or disabled provider.
+func (c *Controller) oauthLoginEndpoint(ctx iris.Context) {
+	providerName := ctx.Params().Get("provider")
+	provider, ok := c.oauthProviders()[providerName]
+	if !ok {
+		c.returnError(ctx, http.StatusNotFound, "unknown or disabled provider")
+		return
+	}
+
+	// If the caller is already authenticated then this is an account-linking
+	// request rather than a fresh sign-in; thread the existing LoginId
+	// through the state so the callback knows to link instead of mint a new
+	// login.
+	var loginId uint64
+	if claims := c.getAuthenticatedClaims(ctx); claims != nil {
+		loginId = claims.LoginId
+	}
+
+	state, err := c.signOAuthState(oauthState{
+		Nonce:     generateOAuthNonce(),
+		LoginId:   loginId,
+		ExpiresAt: time.Now().Add(oauthStateTTL).Unix(),
+	})
+	if err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to begin oauth login")
+		return
+	}
+
+	ctx.SetCookieKV(oauthStateCookieName, state, iris.CookieHTTPOnly(true), iris.CookieExpires(oauthStateTTL))
+	provider.HandleLogin(ctx.ResponseWriter(), ctx.Request(), state)
+}
+
+// oauthCallbackEndpoint completes a third-party sign-in or, for an
+// authenticated account-linking request, attaches the provider identity to
+// the caller's existing login.
+// @Summary OAuth Callback
+// @id oauthCallback
+// @tags Authentication
+// @description Complete sign-in with a third-party identity provider.
+// @Param provider path string true "Provider name, e.g. google, github, apple"
+// @Router /authentication/oauth/{provider}/callback [get]
+// @Success 200 {object} swag.LoginResponse
+// @Failure 400 {object} ApiError Invalid or expired state.
+// @Failure 403 {object} ApiError No login matches this identity.
+func (c *Controller) oauthCallbackEndpoint(ctx iris.Context) {
+	providerName := ctx.Params().Get("provider")
+	provider, ok := c.oauthProviders()[providerName]
+	if !ok {
+		c.returnError(ctx, http.StatusNotFound, "unknown or disabled provider")
+		return
+	}
+
+	cookie := ctx.GetCookie(oauthStateCookieName)
+	ctx.RemoveCookie(oauthStateCookieName)
+
+	state, err := c.verifyOAuthState(cookie, ctx.URLParam("state"))
+	if err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusBadRequest, "invalid or expired oauth state")
+		return
+	}
+
+	identity, err := provider.HandleCallback(ctx.Request())
+	if err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusBadRequest, "failed to complete oauth exchange")
+		return
+	}
+
+	if state.LoginId != 0 {
+		c.linkOAuthIdentity(ctx, state.LoginId, providerName, identity)
+		return
+	}
+
+	c.loginWithOAuthIdentity(ctx, providerName, identity)
+}
+
+// linkOAuthIdentity attaches a provider identity to an already authenticated
+// login so it can be used for future sign-ins.
+func (c *Controller) linkOAuthIdentity(ctx iris.Context, loginId uint64, providerName string, identity oauth.Identity) {
+	loginIdentity := models.LoginIdentity{
+		LoginId:  loginId,
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	var linked bool
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		result, err := txn.ModelContext(c.getContext(ctx), &loginIdentity).
+			OnConflict("(provider, subject) DO NOTHING").
+			Insert()
+		if err != nil {
+			return err
+		}
+
+		linked = result.RowsAffected() == 1
+		return nil
+	}); err != nil {
+		c.wrapPgError(ctx, err, "failed to link identity")
+		return
+	}
+
+	if !linked {
+		// The (provider, subject) row already existed, which OnConflict turned
+		// into a silent no-op. That's only a legitimate no-op if it already
+		// belongs to this login (the caller re-linking); if it belongs to
+		// someone else we must not report success.
+		var existing models.LoginIdentity
+		if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+			return txn.ModelContext(c.getContext(ctx), &existing).
+				Where(`"login_identity"."provider" = ? AND "login_identity"."subject" = ?`, providerName, identity.Subject).
+				Limit(1).
+				Select(&existing)
+		}); err != nil {
+			c.wrapPgError(ctx, err, "failed to link identity")
+			return
+		}
+
+		if existing.LoginId != loginId {
+			c.returnError(ctx, http.StatusConflict, "this identity is already linked to a different account")
+			return
+		}
+	}
+
+	ctx.JSON(map[string]interface{}{
+		"provider": providerName,
+		"email":    identity.Email,
+	})
+}
+
+// loginWithOAuthIdentity exchanges a provider identity for a monetr session,
+// minting the same HarderClaims JWT the password flow uses.
+func (c *Controller) loginWithOAuthIdentity(ctx iris.Context, providerName string, identity oauth.Identity) {
+	var loginIdentity models.LoginIdentity
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		return txn.ModelContext(c.getContext(ctx), &loginIdentity).
+			Relation("Login").
+			Relation("Login.Users").
+			Where(`"login_identity"."provider" = ? AND "login_identity"."subject" = ?`, providerName, identity.Subject).
+			Limit(1).
+			Select(&loginIdentity)
+	}); err != nil {
+		if err == pg.ErrNoRows {
+			c.returnError(ctx, http.StatusForbidden, "no account is linked to this identity")
+			return
+		}
+
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to authenticate")
+		return
+	}
+
+	login := loginIdentity.Login
+	var userId, accountId uint64
+	if len(login.Users) == 1 {
+		userId = login.Users[0].UserId
+		accountId = login.Users[0].AccountId
+	}
+
+	// Route through issueTokenPair like the password and MFA flows so an
+	// OAuth sign-in also gets a refresh token and an audit-log entry rather
+	// than being left on the old single-JWT shape.
+	tokens, err := c.issueTokenPair(ctx, login.LoginId, userId, accountId, true, "")
+	if err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "could not generate JWT")
+		return
+	}
+
+	if len(login.Users) != 1 {
+		tokens["users"] = login.Users
+	}
+
+	ctx.JSON(tokens)
+}
+
+// signOAuthState HMAC-signs an oauthState payload using the same secret the
+// rest of the authentication flow trusts, so no additional secret needs to
+// be provisioned just for this.
+func (c *Controller) signOAuthState(state oauthState) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal oauth state")
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	signature := c.signOAuthPayload(encoded)
+
+	return encoded + "." + signature, nil
+}
+
+// verifyOAuthState validates the signed state cookie against the `state`
+// query parameter the provider echoed back, then checks that it has not
+// expired.
+func (c *Controller) verifyOAuthState(cookieValue, queryValue string) (oauthState, error) {
+	if cookieValue == "" || cookieValue != queryValue {
+		return oauthState{}, errors.New("oauth state mismatch")
+	}
+
+	parts := strings.SplitN(cookieValue, ".", 2)
+	if len(parts) != 2 {
+		return oauthState{}, errors.New("malformed oauth state")
+	}
+
+	encoded, signature := parts[0], parts[1]
+	if !hmac.Equal([]byte(signature), []byte(c.signOAuthPayload(encoded))) {
+		return oauthState{}, errors.New("oauth state signature mismatch")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return oauthState{}, errors.Wrap(err, "failed to decode oauth state")
+	}
+
+	var state oauthState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return oauthState{}, errors.Wrap(err, "failed to unmarshal oauth state")
+	}
+
+	if time.Now().Unix() > state.ExpiresAt {
+		return oauthState{}, errors.New("oauth state has expired")
+	}
+
+	return state, nil
+}
+
+func (c *Controller) signOAuthPayload(encoded string) string {
+	mac := hmac.New(sha256.New, []byte(c.configuration.JWT.LoginJwtSecret))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// getAuthenticatedClaims returns the HarderClaims for the current request if
+// the auth middleware has already validated one, or nil for an
+// unauthenticated request.
+func (c *Controller) getAuthenticatedClaims(ctx iris.Context) *HarderClaims {
+	claims, ok := ctx.Values().Get("claims").(*HarderClaims)
+	if !ok {
+		return nil
+	}
+	return claims
+}
+
+func generateOAuthNonce() string {
+	buffer := make([]byte, 16)
+	_, _ = rand.Read(buffer)
+	return base64.RawURLEncoding.EncodeToString(buffer)
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/monetrapp/rest-api/pkg/hash"
+	"github.com/monetrapp/rest-api/pkg/models"
+	"github.com/monetrapp/rest-api/pkg/validation"
+)
+
+// changePasswordEndpoint lets an authenticated login set a new password.
+// Unlike loginEndpoint, this is where a password is actually being chosen,
+// so it's the right place to enforce the zxcvbn strength score and the
+// breach-list check; running them on every login attempt would eventually
+// lock an existing user out of a password that was fine when they set it.
+// @Summary Change Password
+// @id changePassword
+// @tags Authentication
+// @description Change the password for the caller's login.
+// @Accept json
+// @Param ChangePassword body swag.ChangePasswordRequest true "Change Password Request"
+// @Router /user/security/password [post]
+// @Success 204
+// @Failure 400 {object} ApiError Required data is missing or the password does not meet policy.
+// @Failure 401 {object} ApiError Authentication is required.
+// @Failure 403 {object} ApiError Current password is incorrect.
+func (c *Controller) changePasswordEndpoint(ctx iris.Context) {
+	claims := c.getAuthenticatedClaims(ctx)
+	if claims == nil {
+		c.returnError(ctx, http.StatusUnauthorized, "authentication is required")
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusBadRequest, "failed to decode change password request")
+		return
+	}
+
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		var login models.Login
+		if err := txn.ModelContext(c.getContext(ctx), &login).
+			Where(`"login"."login_id" = ?`, claims.LoginId).
+			Limit(1).
+			Select(&login); err != nil {
+			return err
+		}
+
+		if !hash.Verify(hash.Algorithm(login.PasswordAlgo), login.Email, request.CurrentPassword, login.PasswordHash) {
+			return errInvalidCredentials
+		}
+
+		minScore := c.configuration.Validation.MinPasswordScore
+		if minScore == 0 {
+			minScore = validation.DefaultMinPasswordScore
+		}
+
+		if err := validation.ValidatePassword(validation.PasswordPolicy{MinScore: minScore}, request.NewPassword, login.Email); err != nil {
+			return err
+		}
+
+		if err := validation.ValidateNotBreached(c.breachList, request.NewPassword); err != nil {
+			return err
+		}
+
+		newHash, newAlgo, err := hash.Hash(request.NewPassword)
+		if err != nil {
+			return err
+		}
+
+		login.PasswordHash = newHash
+		login.PasswordAlgo = string(newAlgo)
+		login.PasswordVersion = hash.CurrentVersion
+		// Bump TokenVersion so every outstanding refresh token for this login,
+		// including the caller's own, stops working now that the password
+		// protecting them has changed. Access tokens already issued stay
+		// valid until they expire.
+		login.TokenVersion++
+
+		_, err = txn.ModelContext(c.getContext(ctx), &login).
+			Column("password_hash", "password_algo", "password_version", "token_version").
+			WherePK().
+			Update()
+		return err
+	}); err != nil {
+		if err == errInvalidCredentials {
+			c.returnError(ctx, http.StatusForbidden, "current password is incorrect")
+			return
+		}
+
+		if validationError, ok := err.(validation.Error); ok {
+			c.returnValidationError(ctx, validationError)
+			return
+		}
+
+		c.wrapPgError(ctx, err, "failed to change password")
+		return
+	}
+
+	c.recordAuthEvent(ctx, &claims.LoginId, "", models.AuditEventPasswordChange, ctx.RemoteAddr())
+
+	ctx.StatusCode(http.StatusNoContent)
+}
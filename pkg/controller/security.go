@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/kataras/iris/v12"
+	"github.com/monetrapp/rest-api/pkg/models"
+)
+
+// securityActivityEndpoint lists recent authentication events and active
+// sessions (refresh tokens) for the caller's own login, so they can
+// recognize unfamiliar activity and revoke a session they don't recognize.
+// @Summary Security Activity
+// @id securityActivity
+// @tags Security
+// @description List recent authentication activity and active sessions for the caller.
+// @Router /user/security/activity [get]
+// @Success 200 {object} swag.SecurityActivityResponse
+// @Failure 401 {object} ApiError Authentication is required.
+func (c *Controller) securityActivityEndpoint(ctx iris.Context) {
+	claims := c.getAuthenticatedClaims(ctx)
+	if claims == nil {
+		c.returnError(ctx, http.StatusUnauthorized, "authentication is required")
+		return
+	}
+
+	var events []models.AuditLog
+	var sessions []models.RefreshToken
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		if err := txn.ModelContext(c.getContext(ctx), &events).
+			Where(`"audit_log"."login_id" = ?`, claims.LoginId).
+			Order("created_at DESC").
+			Limit(50).
+			Select(&events); err != nil {
+			return err
+		}
+
+		return txn.ModelContext(c.getContext(ctx), &sessions).
+			Where(`"refresh_token"."login_id" = ? AND "refresh_token"."revoked_at" IS NULL AND "refresh_token"."expires_at" > now()`, claims.LoginId).
+			Where(`"refresh_token"."token_version" = (SELECT "token_version" FROM "logins" WHERE "login_id" = ?)`, claims.LoginId).
+			Order("created_at DESC").
+			Select(&sessions)
+	}); err != nil {
+		c.wrapPgError(ctx, err, "failed to load security activity")
+		return
+	}
+
+	ctx.JSON(map[string]interface{}{
+		"events":   events,
+		"sessions": sessions,
+	})
+}
+
+// revokeSessionEndpoint revokes a single session (refresh token) belonging
+// to the caller's own login, e.g. one they don't recognize in the activity
+// list above.
+// @Summary Revoke Session
+// @id revokeSession
+// @tags Security
+// @description Revoke a single session belonging to the caller.
+// @Param refreshTokenId path uint64 true "Refresh Token ID"
+// @Router /user/security/activity/{refreshTokenId} [delete]
+// @Success 204
+// @Failure 401 {object} ApiError Authentication is required.
+func (c *Controller) revokeSessionEndpoint(ctx iris.Context) {
+	claims := c.getAuthenticatedClaims(ctx)
+	if claims == nil {
+		c.returnError(ctx, http.StatusUnauthorized, "authentication is required")
+		return
+	}
+
+	refreshTokenId, err := ctx.Params().GetUint64("refreshTokenId")
+	if err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusBadRequest, "invalid refresh token id")
+		return
+	}
+
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		_, err := txn.ModelContext(c.getContext(ctx), (*models.RefreshToken)(nil)).
+			Set("revoked_at = now()").
+			Where(`"refresh_token"."refresh_token_id" = ? AND "refresh_token"."login_id" = ?`, refreshTokenId, claims.LoginId).
+			Update()
+		return err
+	}); err != nil {
+		c.wrapPgError(ctx, err, "failed to revoke session")
+		return
+	}
+
+	ctx.StatusCode(http.StatusNoContent)
+}
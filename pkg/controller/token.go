@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/kataras/iris/v12"
+	"github.com/monetrapp/rest-api/pkg/models"
+	"github.com/pkg/errors"
+)
+
+// refreshTokenLifetime bounds how long a refresh token can be redeemed for
+// new access tokens before the client has to log in again.
+const refreshTokenLifetime = 30 * 24 * time.Hour
+
+// issueRefreshToken mints a new opaque refresh token, persisting only its
+// hash (and device metadata) so a stolen database dump can't be replayed as
+// a session.
+func (c *Controller) issueRefreshToken(ctx iris.Context, loginId uint64, deviceId string) (string, error) {
+	plaintext, err := generateRefreshTokenSecret()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate refresh token")
+	}
+
+	refreshToken := models.RefreshToken{
+		LoginId:      loginId,
+		DeviceId:     deviceId,
+		UserAgent:    ctx.Request().UserAgent(),
+		IpAddress:    ctx.RemoteAddr(),
+		TokenHash:    hashRefreshToken(plaintext),
+		TokenVersion: 0, // set below once we know the login's current version
+		ExpiresAt:    time.Now().Add(refreshTokenLifetime),
+	}
+
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		var login models.Login
+		if err := txn.ModelContext(c.getContext(ctx), &login).
+			Column("token_version").
+			Where(`"login"."login_id" = ?`, loginId).
+			Select(&login); err != nil {
+			return err
+		}
+
+		refreshToken.TokenVersion = login.TokenVersion
+
+		_, err := txn.ModelContext(c.getContext(ctx), &refreshToken).Insert()
+		return err
+	}); err != nil {
+		return "", errors.Wrap(err, "failed to store refresh token")
+	}
+
+	return plaintext, nil
+}
+
+// refreshEndpoint exchanges a still-valid refresh token for a new access
+// token, without requiring the password again.
+// @Summary Refresh
+// @id refresh
+// @tags Authentication
+// @description Exchange a refresh token for a new access token.
+// @Accept json
+// @Produce json
+// @Router /authentication/refresh [post]
+// @Success 200 {object} swag.LoginResponse
+// @Failure 403 {object} ApiError Refresh token is invalid, expired, or revoked.
+func (c *Controller) refreshEndpoint(ctx iris.Context) {
+	var request struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusBadRequest, "failed to decode refresh request")
+		return
+	}
+
+	var stored models.RefreshToken
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		return txn.ModelContext(c.getContext(ctx), &stored).
+			Where(`"refresh_token"."token_hash" = ?`, hashRefreshToken(request.RefreshToken)).
+			Limit(1).
+			Select(&stored)
+	}); err != nil {
+		if err == pg.ErrNoRows {
+			c.returnError(ctx, http.StatusForbidden, "invalid refresh token")
+			return
+		}
+
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to look up refresh token")
+		return
+	}
+
+	var login models.Login
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		return txn.ModelContext(c.getContext(ctx), &login).
+			Relation("Users").
+			Where(`"login"."login_id" = ?`, stored.LoginId).
+			Limit(1).
+			Select(&login)
+	}); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to load login")
+		return
+	}
+
+	if !stored.Active(login.TokenVersion) {
+		c.returnError(ctx, http.StatusForbidden, "refresh token is no longer valid")
+		return
+	}
+
+	var userId, accountId uint64
+	if len(login.Users) == 1 {
+		userId = login.Users[0].UserId
+		accountId = login.Users[0].AccountId
+	}
+
+	accessToken, _, err := c.generateToken(login.LoginId, userId, accountId, true, stored.DeviceId)
+	if err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "could not generate JWT")
+		return
+	}
+
+	c.recordAuthEvent(ctx, &login.LoginId, "", models.AuditEventTokenRefresh, ctx.RemoteAddr())
+
+	ctx.JSON(map[string]interface{}{
+		"token": accessToken,
+	})
+}
+
+// logoutEndpoint revokes the refresh token presented by the client and adds
+// the current access token's jti to the blocklist so it cannot be used
+// again for the remainder of its lifetime.
+// @Summary Logout
+// @id logout
+// @tags Authentication
+// @description Revoke the caller's refresh token and access token.
+// @Accept json
+// @Router /authentication/logout [post]
+// @Success 204
+func (c *Controller) logoutEndpoint(ctx iris.Context) {
+	var request struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	_ = ctx.ReadJSON(&request)
+
+	// Prefer the authenticated claims for the audit log, but a logout can
+	// also be called with just a refresh token, so fall back to the login it
+	// belongs to.
+	var loginId *uint64
+	if claims := c.getAuthenticatedClaims(ctx); claims != nil {
+		loginId = &claims.LoginId
+	}
+
+	if request.RefreshToken != "" {
+		if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+			var stored models.RefreshToken
+			if err := txn.ModelContext(c.getContext(ctx), &stored).
+				Where(`"refresh_token"."token_hash" = ?`, hashRefreshToken(request.RefreshToken)).
+				Limit(1).
+				Select(&stored); err != nil {
+				return err
+			}
+
+			if loginId == nil {
+				loginId = &stored.LoginId
+			}
+
+			_, err := txn.ModelContext(c.getContext(ctx), &stored).
+				Set("revoked_at = now()").
+				WherePK().
+				Update()
+			return err
+		}); err != nil && err != pg.ErrNoRows {
+			c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to revoke refresh token")
+			return
+		}
+	}
+
+	if claims := c.getAuthenticatedClaims(ctx); claims != nil && claims.Id != "" {
+		expiresAt := time.Unix(claims.ExpiresAt, 0)
+		if err := c.blocklist.Revoke(claims.Id, expiresAt); err != nil {
+			c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to revoke access token")
+			return
+		}
+	}
+
+	c.recordAuthEvent(ctx, loginId, "", models.AuditEventLogout, ctx.RemoteAddr())
+
+	ctx.StatusCode(http.StatusNoContent)
+}
+
+// logoutAllEndpoint bumps the login's token version, which immediately
+// invalidates every outstanding refresh token regardless of device.
+// @Summary Logout All
+// @id logoutAll
+// @tags Authentication
+// @description Revoke every refresh token issued for the caller's login.
+// @Router /authentication/logout-all [post]
+// @Success 204
+func (c *Controller) logoutAllEndpoint(ctx iris.Context) {
+	claims := c.getAuthenticatedClaims(ctx)
+	if claims == nil {
+		c.returnError(ctx, http.StatusUnauthorized, "authentication is required")
+		return
+	}
+
+	if err := c.db.RunInTransaction(c.getContext(ctx), func(txn *pg.Tx) error {
+		_, err := txn.ModelContext(c.getContext(ctx), (*models.Login)(nil)).
+			Set(`"token_version" = "token_version" + 1`).
+			Where(`"login"."login_id" = ?`, claims.LoginId).
+			Update()
+		return err
+	}); err != nil {
+		c.wrapAndReturnError(ctx, err, http.StatusInternalServerError, "failed to revoke sessions")
+		return
+	}
+
+	c.recordAuthEvent(ctx, &claims.LoginId, "", models.AuditEventLogout, ctx.RemoteAddr())
+
+	ctx.StatusCode(http.StatusNoContent)
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateRefreshTokenSecret() (string, error) {
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+func generateDeviceId() string {
+	return uuid.New().String()
+}
@@ -0,0 +1,92 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithm identifies which algorithm a password hash was produced with,
+// so Verify knows how to compare it and loginEndpoint knows whether it
+// needs a transparent rehash.
+type Algorithm string
+
+const (
+	// AlgorithmLegacySHA is the original deterministic, unsalted-per-user
+	// hash (see HashPassword). It is only ever verified against; Hash never
+	// produces it.
+	AlgorithmLegacySHA Algorithm = "legacy-sha256"
+
+	// AlgorithmBcrypt is the current algorithm: bcrypt with a random
+	// per-password salt baked into the stored hash.
+	AlgorithmBcrypt Algorithm = "bcrypt"
+)
+
+// CurrentAlgorithm is what Hash produces new hashes under. A future
+// algorithm change should only need to update this package.
+const CurrentAlgorithm = AlgorithmBcrypt
+
+// bcryptCost is deliberately the library default rather than hand-tuned, so
+// it tracks upstream guidance on acceptable work factor as hardware
+// improves.
+const bcryptCost = bcrypt.DefaultCost
+
+// CurrentVersion identifies the parameters (currently just bcryptCost) that
+// Hash produces a hash under. Bumping this without changing CurrentAlgorithm
+// (e.g. raising bcryptCost) is enough to make every login's next successful
+// sign-in transparently rehash under the new parameters, the same way a
+// full algorithm change does.
+const CurrentVersion = 1
+
+// Hash produces a new password hash under CurrentAlgorithm. The returned
+// value already encodes its own salt.
+func Hash(password string) (hashed string, algorithm Algorithm, err error) {
+	encoded, err := bcrypt.GenerateFromPassword(bcryptInput(password), bcryptCost)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to hash password")
+	}
+
+	return string(encoded), CurrentAlgorithm, nil
+}
+
+// bcryptInput reduces password to a fixed-size SHA-256 digest before it
+// reaches bcrypt, which only examines its first 72 bytes and errors outright
+// on longer input. The legacy scheme this replaced had no length limit, so
+// without this an existing password over 72 bytes would pass the legacy
+// check on login and then fail the forced rehash, or fail outright if
+// chosen fresh via changePasswordEndpoint.
+func bcryptInput(password string) []byte {
+	sum := sha256.Sum256([]byte(password))
+	return []byte(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// Verify checks a password against a previously stored hash. email is only
+// used when algorithm is the legacy scheme, which folded it into the hash
+// in place of a random salt.
+func Verify(algorithm Algorithm, email, password, stored string) bool {
+	switch algorithm {
+	case AlgorithmBcrypt:
+		return bcrypt.CompareHashAndPassword([]byte(stored), bcryptInput(password)) == nil
+	case AlgorithmLegacySHA, "":
+		// The password_algo column defaults to the legacy algorithm (see
+		// models.Login); an empty value is treated as legacy as well.
+		return HashPassword(email, password) == stored
+	default:
+		return false
+	}
+}
+
+// HashPassword is the original, deterministic, unsalted-per-user password
+// hash. It is retained only so existing logins can still be verified and
+// transparently upgraded to Hash on their next successful login; it must
+// never be used to hash a new password.
+//
+// Deprecated: use Hash instead.
+func HashPassword(email, password string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email) + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
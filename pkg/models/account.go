@@ -0,0 +1,9 @@
+package models
+
+// Account represents a single household/organization's budget. Users belong
+// to exactly one Account.
+type Account struct {
+	tableName struct{} `pg:"accounts"`
+
+	AccountId uint64 `json:"accountId" pg:"account_id,pk"`
+}
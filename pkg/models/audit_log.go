@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// AuditEventType identifies what kind of authentication event an AuditLog
+// row records.
+type AuditEventType string
+
+const (
+	AuditEventLoginSuccess   AuditEventType = "login_success"
+	AuditEventLoginFailure   AuditEventType = "login_failure"
+	AuditEventMfaChallenge   AuditEventType = "mfa_challenge"
+	AuditEventTokenRefresh   AuditEventType = "token_refresh"
+	AuditEventLogout         AuditEventType = "logout"
+	AuditEventPasswordChange AuditEventType = "password_change"
+)
+
+// AuditLog is an append-only record of every authentication-relevant event
+// for a login: successes, failures, MFA challenges, token refreshes, and
+// logouts. It backs both the user-facing "recent activity" view and
+// incident investigation. LoginId is nullable because a failed login with
+// an unrecognized email never resolves to one.
+type AuditLog struct {
+	tableName struct{} `pg:"audit_log"`
+
+	AuditLogId uint64         `json:"auditLogId" pg:"audit_log_id,pk"`
+	LoginId    *uint64        `json:"loginId,omitempty" pg:"login_id"`
+	Email      string         `json:"email,omitempty" pg:"email"`
+	EventType  AuditEventType `json:"eventType" pg:"event_type,notnull"`
+	IpAddress  string         `json:"ipAddress" pg:"ip_address"`
+	UserAgent  string         `json:"userAgent" pg:"user_agent"`
+	CreatedAt  time.Time      `json:"createdAt" pg:"created_at,notnull,default:now()"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Login represents a single set of credentials that one or more Users
+// authenticate with. A Login can be associated with more than one User when
+// the same person has access to multiple accounts (e.g. personal and a
+// shared household account).
+type Login struct {
+	tableName struct{} `pg:"logins"`
+
+	LoginId      uint64    `json:"loginId" pg:"login_id,pk"`
+	Email        string    `json:"email" pg:"email,notnull,unique"`
+	PasswordHash string    `json:"-" pg:"password_hash,notnull"`
+	Users        []User    `json:"users,omitempty" pg:"rel:has-many"`
+	CreatedAt    time.Time `json:"createdAt" pg:"created_at,notnull,default:now()"`
+
+	// PasswordAlgo records which algorithm PasswordHash was produced with
+	// (see pkg/hash), so a legacy hash can still be verified while new
+	// passwords are hashed under the current algorithm. PasswordVersion is
+	// compared against hash.CurrentVersion on login, so bumping
+	// hash.CurrentVersion after a future parameter change to the same
+	// algorithm (e.g. a higher bcrypt cost) triggers a transparent rehash
+	// the same way a full algorithm change does.
+	PasswordAlgo    string `json:"-" pg:"password_algo,notnull,default:'legacy-sha256'"`
+	PasswordVersion int    `json:"-" pg:"password_version,notnull,default:0"`
+
+	// TokenVersion is bumped whenever every outstanding refresh token for
+	// this login should be invalidated at once, e.g. a password change or a
+	// "log out of all devices" request. Refresh tokens issued under an older
+	// version are rejected even if they have not individually expired.
+	TokenVersion int `json:"-" pg:"token_version,notnull,default:0"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// LoginAttempt tracks consecutive failed logins for a single (email, IP)
+// pair so pkg/security can apply exponential backoff and, eventually, a
+// temporary lockout. A successful login for the pair deletes the row.
+type LoginAttempt struct {
+	tableName struct{} `pg:"login_attempts"`
+
+	Email         string     `json:"-" pg:"email,pk"`
+	IpAddress     string     `json:"-" pg:"ip_address,pk"`
+	FailureCount  int        `json:"-" pg:"failure_count,notnull,default:0"`
+	LastFailureAt *time.Time `json:"-" pg:"last_failure_at"`
+	LockedUntil   *time.Time `json:"-" pg:"locked_until"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// LoginIdentity links a Login to a third-party identity provider account so
+// that it can be used to sign in with Google, GitHub, Apple, etc. in
+// addition to (or instead of) a password. Each (provider, subject) pair
+// belongs to at most one Login, and a Login may link several providers;
+// nothing stops a Login from linking two accounts at the same provider.
+type LoginIdentity struct {
+	tableName struct{} `pg:"login_identities"`
+
+	LoginIdentityId uint64    `json:"loginIdentityId" pg:"login_identity_id,pk"`
+	LoginId         uint64    `json:"loginId" pg:"login_id,notnull"`
+	Login           *Login    `json:"-" pg:"rel:has-one"`
+	Provider        string    `json:"provider" pg:"provider,notnull"`
+	Subject         string    `json:"-" pg:"subject,notnull"`
+	Email           string    `json:"email" pg:"email,notnull"`
+	CreatedAt       time.Time `json:"createdAt" pg:"created_at,notnull,default:now()"`
+}
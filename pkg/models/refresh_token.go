@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// RefreshToken is a long-lived, opaque credential a client exchanges for a
+// new access JWT without having to reauthenticate with a password. Only the
+// SHA-256 hash of the token is ever persisted; the plaintext is returned to
+// the client exactly once, at creation time.
+type RefreshToken struct {
+	tableName struct{} `pg:"refresh_tokens"`
+
+	RefreshTokenId uint64     `json:"refreshTokenId" pg:"refresh_token_id,pk"`
+	LoginId        uint64     `json:"loginId" pg:"login_id,notnull"`
+	DeviceId       string     `json:"deviceId" pg:"device_id,notnull"`
+	UserAgent      string     `json:"userAgent" pg:"user_agent"`
+	IpAddress      string     `json:"ipAddress" pg:"ip_address"`
+	TokenHash      string     `json:"-" pg:"token_hash,notnull,unique"`
+	TokenVersion   int        `json:"-" pg:"token_version,notnull"`
+	ExpiresAt      time.Time  `json:"expiresAt" pg:"expires_at,notnull"`
+	RevokedAt      *time.Time `json:"revokedAt" pg:"revoked_at"`
+	CreatedAt      time.Time  `json:"createdAt" pg:"created_at,notnull,default:now()"`
+}
+
+// Active reports whether this refresh token can still be redeemed: it has
+// not been explicitly revoked, has not expired, and was issued under the
+// login's current token version (a password change or logout-all bumps the
+// version and implicitly revokes every outstanding token at once).
+func (r RefreshToken) Active(currentTokenVersion int) bool {
+	if r.RevokedAt != nil {
+		return false
+	}
+	if r.TokenVersion != currentTokenVersion {
+		return false
+	}
+	return time.Now().Before(r.ExpiresAt)
+}
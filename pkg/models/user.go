@@ -0,0 +1,12 @@
+package models
+
+// User represents a single member of an Account. A Login owns one User per
+// Account it has access to.
+type User struct {
+	tableName struct{} `pg:"users"`
+
+	UserId    uint64   `json:"userId" pg:"user_id,pk"`
+	LoginId   uint64   `json:"loginId" pg:"login_id,notnull"`
+	AccountId uint64   `json:"accountId" pg:"account_id,notnull"`
+	Account   *Account `json:"account,omitempty" pg:"rel:has-one"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// UserTotp stores a login's TOTP (RFC 6238) secret for optional two-factor
+// authentication. EncryptedSecret is AES-256-GCM encrypted with the
+// server's configured encryption key; it is never returned in an API
+// response once enrollment is complete.
+type UserTotp struct {
+	tableName struct{} `pg:"user_totp"`
+
+	LoginId         uint64    `json:"loginId" pg:"login_id,pk"`
+	EncryptedSecret string    `json:"-" pg:"encrypted_secret,notnull"`
+	Enabled         bool      `json:"enabled" pg:"enabled,notnull,default:false"`
+	CreatedAt       time.Time `json:"createdAt" pg:"created_at,notnull,default:now()"`
+}
+
+// RecoveryCode is a single-use backup code that can be redeemed in place of
+// a TOTP code if the user loses access to their authenticator app. Only the
+// SHA-256 hash is stored; the plaintext codes are shown to the user exactly
+// once, at enrollment.
+type RecoveryCode struct {
+	tableName struct{} `pg:"user_totp_recovery_codes"`
+
+	RecoveryCodeId uint64     `json:"recoveryCodeId" pg:"recovery_code_id,pk"`
+	LoginId        uint64     `json:"loginId" pg:"login_id,notnull"`
+	CodeHash       string     `json:"-" pg:"code_hash,notnull"`
+	UsedAt         *time.Time `json:"-" pg:"used_at"`
+	CreatedAt      time.Time  `json:"createdAt" pg:"created_at,notnull,default:now()"`
+}
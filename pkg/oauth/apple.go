@@ -0,0 +1,205 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/form3tech-oss/jwt-go"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// appleEndpoint is Apple's fixed authorization and token endpoint pair,
+// hard-coded here the same way the Google and GitHub providers use the fixed
+// endpoints from golang.org/x/oauth2.
+var appleEndpoint = oauth2.Endpoint{
+	AuthURL:  "https://appleid.apple.com/auth/authorize",
+	TokenURL: "https://appleid.apple.com/auth/token",
+}
+
+// appleIssuer and appleJWKSURL are Apple's fixed OIDC issuer and signing-key
+// endpoint; Sign in with Apple has no discovery document to source these
+// from.
+const appleIssuer = "https://appleid.apple.com"
+const appleJWKSURL = "https://appleid.apple.com/auth/keys"
+
+// appleProvider implements AuthProvider against "Sign in with Apple". Apple
+// authenticates the client itself with a JWT signed by the app's private
+// key rather than a static client secret, so the secret is (re)minted for
+// every token exchange.
+type appleProvider struct {
+	config     oauth2.Config
+	teamId     string
+	keyId      string
+	privateKey []byte
+}
+
+// NewAppleProvider builds an Apple AuthProvider from the service identifier,
+// team/key IDs, and PEM-encoded private key configured for this deployment.
+func NewAppleProvider(clientId, teamId, keyId string, privateKey []byte, redirectURL string) AuthProvider {
+	return &appleProvider{
+		config: oauth2.Config{
+			ClientID:    clientId,
+			RedirectURL: redirectURL,
+			Scopes:      []string{"name", "email"},
+			Endpoint:    appleEndpoint,
+		},
+		teamId:     teamId,
+		keyId:      keyId,
+		privateKey: privateKey,
+	}
+}
+
+func (a *appleProvider) Name() string {
+	return "apple"
+}
+
+func (a *appleProvider) HandleLogin(w http.ResponseWriter, r *http.Request, state string) {
+	// Apple requires form_post response handling for name/email on first
+	// authorization; we ask for the code-only flow and rely on the `id_token`
+	// it still returns for the subject.
+	http.Redirect(w, r, a.config.AuthCodeURL(state, oauth2.SetAuthURLParam("response_mode", "form_post")), http.StatusFound)
+}
+
+func (a *appleProvider) HandleCallback(r *http.Request) (Identity, error) {
+	if err := r.ParseForm(); err != nil {
+		return Identity{}, errors.Wrap(err, "failed to parse apple callback")
+	}
+
+	code := r.Form.Get("code")
+	if code == "" {
+		return Identity{}, errors.New("missing authorization code")
+	}
+
+	clientSecret, err := a.clientSecret()
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "failed to mint apple client secret")
+	}
+	a.config.ClientSecret = clientSecret
+
+	token, err := a.config.Exchange(context.Background(), code)
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "failed to exchange authorization code")
+	}
+
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIdToken == "" {
+		return Identity{}, errors.New("apple token response did not include an id_token")
+	}
+
+	claims, err := a.verifyIdToken(rawIdToken)
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "failed to verify apple id_token")
+	}
+
+	return Identity{
+		Subject: claims.Subject,
+		Email:   r.Form.Get("email"),
+	}, nil
+}
+
+// verifyIdToken checks the id_token's signature against Apple's published
+// JWKS and confirms it was actually issued by Apple for this app, rather
+// than trusting the subject claim of an unverified token.
+func (a *appleProvider) verifyIdToken(rawIdToken string) (*jwt.StandardClaims, error) {
+	var claims jwt.StandardClaims
+	token, err := jwt.ParseWithClaims(rawIdToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return fetchApplePublicKey(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("apple id_token is not valid")
+	}
+	if !claims.VerifyIssuer(appleIssuer, true) {
+		return nil, errors.New("apple id_token has an unexpected issuer")
+	}
+	if !claims.VerifyAudience(a.config.ClientID, true) {
+		return nil, errors.New("apple id_token has an unexpected audience")
+	}
+
+	return &claims, nil
+}
+
+// clientSecret mints the short-lived JWT Apple requires in place of a
+// static OAuth client secret, signed with the app's ES256 private key.
+func (a *appleProvider) clientSecret() (string, error) {
+	key, err := jwt.ParseECPrivateKeyFromPEM(a.privateKey)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid apple private key")
+	}
+
+	now := time.Now()
+	claims := jwt.StandardClaims{
+		Issuer:    a.teamId,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(5 * time.Minute).Unix(),
+		Audience:  []string{appleIssuer},
+		Subject:   a.config.ClientID,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = a.keyId
+
+	return token.SignedString(key)
+}
+
+// applePublicKey is a single entry of Apple's JWKS response.
+type applePublicKey struct {
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// fetchApplePublicKey retrieves Apple's current signing keys and returns the
+// RSA public key matching kid. Apple rotates these infrequently, so a
+// production deployment would want to cache this rather than fetch it on
+// every callback; that's left as a follow-up.
+func fetchApplePublicKey(kid string) (*rsa.PublicKey, error) {
+	if kid == "" {
+		return nil, errors.New("apple id_token is missing a key id")
+	}
+
+	response, err := http.Get(appleJWKSURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch apple jwks")
+	}
+	defer response.Body.Close()
+
+	var jwks struct {
+		Keys []applePublicKey `json:"keys"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&jwks); err != nil {
+		return nil, errors.Wrap(err, "failed to decode apple jwks")
+	}
+
+	for _, key := range jwks.Keys {
+		if key.Kid != kid {
+			continue
+		}
+
+		nBytes, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode apple jwks modulus")
+		}
+
+		eBytes, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode apple jwks exponent")
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(nBytes),
+			E: int(new(big.Int).SetBytes(eBytes).Int64()),
+		}, nil
+	}
+
+	return nil, errors.Errorf("no apple signing key found for kid %q", kid)
+}
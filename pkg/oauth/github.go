@@ -0,0 +1,108 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	githuboauth "golang.org/x/oauth2/github"
+)
+
+// githubProvider implements AuthProvider against GitHub's OAuth2 endpoints.
+// GitHub does not speak OIDC, so the subject is synthesized from the
+// numeric user ID returned by the GitHub API.
+type githubProvider struct {
+	config oauth2.Config
+}
+
+// NewGitHubProvider builds a GitHub AuthProvider from the client credentials
+// configured for this deployment.
+func NewGitHubProvider(clientId, clientSecret, redirectURL string) AuthProvider {
+	return &githubProvider{
+		config: oauth2.Config{
+			ClientID:     clientId,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"read:user", "user:email"},
+			Endpoint:     githuboauth.Endpoint,
+		},
+	}
+}
+
+func (g *githubProvider) Name() string {
+	return "github"
+}
+
+func (g *githubProvider) HandleLogin(w http.ResponseWriter, r *http.Request, state string) {
+	http.Redirect(w, r, g.config.AuthCodeURL(state, oauth2.AccessTypeOnline), http.StatusFound)
+}
+
+func (g *githubProvider) HandleCallback(r *http.Request) (Identity, error) {
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		return Identity{}, errors.New("missing authorization code")
+	}
+
+	token, err := g.config.Exchange(context.Background(), code)
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "failed to exchange authorization code")
+	}
+
+	client := g.config.Client(context.Background(), token)
+	response, err := client.Get("https://api.github.com/user")
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "failed to retrieve github user")
+	}
+	defer response.Body.Close()
+
+	var profile struct {
+		ID    int64  `json:"id"`
+		Email string `json:"email"`
+		Name  string `json:"name"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&profile); err != nil {
+		return Identity{}, errors.Wrap(err, "failed to decode github user")
+	}
+
+	if profile.Email == "" {
+		if email, err := g.primaryEmail(client); err == nil {
+			profile.Email = email
+		}
+	}
+
+	return Identity{
+		Subject: strconv.FormatInt(profile.ID, 10),
+		Email:   profile.Email,
+		Name:    profile.Name,
+	}, nil
+}
+
+// primaryEmail falls back to the /user/emails endpoint for accounts that
+// keep their primary email private on their profile.
+func (g *githubProvider) primaryEmail(client *http.Client) (string, error) {
+	response, err := client.Get("https://api.github.com/user/emails")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to retrieve github emails")
+	}
+	defer response.Body.Close()
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&emails); err != nil {
+		return "", errors.Wrap(err, "failed to decode github emails")
+	}
+
+	for _, email := range emails {
+		if email.Primary && email.Verified {
+			return email.Email, nil
+		}
+	}
+
+	return "", errors.New("no verified primary email found")
+}
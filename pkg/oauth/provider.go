@@ -0,0 +1,37 @@
+package oauth
+
+import (
+	"net/http"
+)
+
+// AuthProvider is implemented by every third-party identity provider that
+// monetr can authenticate a login against (Google, GitHub, Apple, ...). Each
+// provider owns the details of its own consent screen and token exchange;
+// the controller layer only ever deals with the normalized Identity it
+// returns.
+type AuthProvider interface {
+	// Name returns the lowercase, URL-safe identifier for this provider. It
+	// is used as the `{provider}` path parameter on the OAuth routes and as
+	// the `provider` column on `login_identities`.
+	Name() string
+
+	// HandleLogin redirects the caller to the provider's consent screen.
+	// State has already been generated and signed by the caller and must be
+	// passed through untouched so it comes back on the callback.
+	HandleLogin(w http.ResponseWriter, r *http.Request, state string)
+
+	// HandleCallback exchanges the authorization code present on the
+	// request for the provider's stable subject identifier and whatever
+	// profile information the provider is willing to share.
+	HandleCallback(r *http.Request) (Identity, error)
+}
+
+// Identity is the normalized result of a successful OAuth/OIDC exchange.
+// Subject is the provider's stable, opaque identifier for the account (the
+// `sub` claim for OIDC providers) and is what actually gets matched against
+// `login_identities`; Email is only used to pre-fill account linking.
+type Identity struct {
+	Subject string
+	Email   string
+	Name    string
+}
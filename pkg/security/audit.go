@@ -0,0 +1,17 @@
+package security
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/monetrapp/rest-api/pkg/models"
+)
+
+// RecordAuditEvent appends a single row to the audit log. It deliberately
+// returns the insert error rather than swallowing it, so a caller that
+// considers audit logging load-bearing (e.g. a compliance requirement) can
+// choose to fail the request on a write failure.
+func RecordAuditEvent(ctx context.Context, db *pg.DB, event models.AuditLog) error {
+	_, err := db.ModelContext(ctx, &event).Insert()
+	return err
+}
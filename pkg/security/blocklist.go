@@ -0,0 +1,123 @@
+package security
+
+import (
+	"sync"
+	"time"
+)
+
+// revokedTokenChannel is the pub/sub channel used to broadcast a revocation
+// to every other API replica so an access token can't outlive its revocation
+// by being checked against a different instance's in-memory state.
+const revokedTokenChannel = "monetr.revoked-jtis"
+
+// Publisher is the minimal pub/sub surface Blocklist needs to fan a
+// revocation out to other replicas. It is satisfied by a thin wrapper
+// around redis, but kept as an interface here so this package has no direct
+// dependency on a particular pub/sub client.
+type Publisher interface {
+	Publish(channel string, message []byte) error
+}
+
+// Subscriber is the minimal pub/sub surface Blocklist needs to learn about
+// revocations broadcast by other replicas.
+type Subscriber interface {
+	Subscribe(channel string, handler func(message []byte)) error
+}
+
+// Listen subscribes to revocations broadcast by other replicas and applies
+// them locally. It blocks for as long as the underlying subscription does
+// and is meant to be run in its own goroutine at startup.
+func (b *Blocklist) Listen(subscriber Subscriber) error {
+	return subscriber.Subscribe(revokedTokenChannel, func(message []byte) {
+		b.onRemoteRevoke(string(message))
+	})
+}
+
+// Blocklist is an in-memory set of revoked JWT IDs (jti) that the auth
+// middleware consults on every request in addition to normal signature and
+// expiry validation. It is seeded from the database at startup and kept in
+// sync across replicas by a pub/sub broadcast whenever a token is revoked.
+type Blocklist struct {
+	mu        sync.RWMutex
+	revoked   map[string]time.Time // jti -> the access token's own expiry
+	publisher Publisher
+}
+
+// NewBlocklist creates an empty Blocklist. Call Seed once at startup to
+// populate it from persisted revocations, and Listen to start listening
+// for revocations broadcast by other replicas.
+func NewBlocklist(publisher Publisher) *Blocklist {
+	return &Blocklist{
+		revoked:   map[string]time.Time{},
+		publisher: publisher,
+	}
+}
+
+// Seed populates the blocklist from revocations loaded at startup, e.g. from
+// a table of revoked JTIs or from refresh tokens that were revoked inside
+// the access token lifetime. Entries whose expiry is already in the past are
+// skipped since they can no longer be presented as a valid access token.
+func (b *Blocklist) Seed(jtis map[string]time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for jti, expiresAt := range jtis {
+		if expiresAt.After(now) {
+			b.revoked[jti] = expiresAt
+		}
+	}
+}
+
+// Revoke marks a jti as revoked locally and broadcasts the revocation to
+// other replicas. expiresAt should be the access token's own expiry so the
+// entry can be garbage collected once it could no longer be presented as
+// valid anyway.
+func (b *Blocklist) Revoke(jti string, expiresAt time.Time) error {
+	b.mu.Lock()
+	b.revoked[jti] = expiresAt
+	b.mu.Unlock()
+
+	if b.publisher == nil {
+		return nil
+	}
+
+	return b.publisher.Publish(revokedTokenChannel, []byte(jti))
+}
+
+// onRemoteRevoke is invoked by the pub/sub subscriber when another replica
+// broadcasts a revocation. We don't know the remote token's expiry, so we
+// hold it for the maximum plausible access token lifetime; the next Seed at
+// restart will correct it to the real value.
+func (b *Blocklist) onRemoteRevoke(jti string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.revoked[jti]; !ok {
+		b.revoked[jti] = time.Now().Add(24 * time.Hour)
+	}
+}
+
+// IsRevoked reports whether a jti has been revoked.
+func (b *Blocklist) IsRevoked(jti string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	_, ok := b.revoked[jti]
+	return ok
+}
+
+// GC removes entries whose access token could not possibly still be valid,
+// keeping the map from growing without bound. Callers are expected to run
+// this periodically, e.g. once a minute.
+func (b *Blocklist) GC() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for jti, expiresAt := range b.revoked {
+		if now.After(expiresAt) {
+			delete(b.revoked, jti)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package security
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/monetrapp/rest-api/pkg/models"
+)
+
+// LockoutPolicy controls how aggressively RateLimiter backs off a
+// (email, IP) pair after consecutive failed logins.
+type LockoutPolicy struct {
+	// MaxFailures is how many consecutive failures are tolerated before the
+	// pair is locked out entirely.
+	MaxFailures int
+
+	// BaseDelay is the backoff applied after the first failure; each
+	// subsequent failure doubles it, up to LockDuration.
+	BaseDelay time.Duration
+
+	// LockDuration is how long a pair is locked out for once MaxFailures is
+	// reached.
+	LockDuration time.Duration
+
+	// RequireCaptchaAfter is how many failures must accumulate before a
+	// captcha is required on the pair's next attempt. Zero disables this
+	// independent of the deployment's unconditional captcha setting.
+	RequireCaptchaAfter int
+}
+
+// DefaultLockoutPolicy is used whenever Configuration.RateLimit doesn't
+// override it.
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxFailures:         10,
+		BaseDelay:           time.Second,
+		LockDuration:        15 * time.Minute,
+		RequireCaptchaAfter: 1,
+	}
+}
+
+// RateLimiter tracks failed login attempts per (email, IP) in Postgres and
+// decides whether a given attempt should be allowed right now, backed off,
+// or rejected outright because the pair is locked out.
+type RateLimiter struct {
+	db     *pg.DB
+	policy LockoutPolicy
+}
+
+func NewRateLimiter(db *pg.DB, policy LockoutPolicy) *RateLimiter {
+	return &RateLimiter{db: db, policy: policy}
+}
+
+// Check reports whether a login attempt for (email, ip) should be allowed
+// right now, and whether a captcha should be required even if the
+// deployment doesn't otherwise always require one.
+func (r *RateLimiter) Check(ctx context.Context, email, ip string) (allowed bool, requireCaptcha bool, err error) {
+	var attempt models.LoginAttempt
+	err = r.db.ModelContext(ctx, &attempt).
+		Where(`"login_attempt"."email" = ? AND "login_attempt"."ip_address" = ?`, email, ip).
+		Limit(1).
+		Select(&attempt)
+	if err == pg.ErrNoRows {
+		return true, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	now := time.Now()
+	if attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+		return false, true, nil
+	}
+
+	requireCaptcha = r.policy.RequireCaptchaAfter > 0 && attempt.FailureCount >= r.policy.RequireCaptchaAfter
+
+	if attempt.LastFailureAt != nil {
+		if now.Before(attempt.LastFailureAt.Add(r.backoff(attempt.FailureCount))) {
+			return false, requireCaptcha, nil
+		}
+	}
+
+	return true, requireCaptcha, nil
+}
+
+// RecordFailure increments the failure count for (email, ip), locking it
+// out once MaxFailures is reached.
+func (r *RateLimiter) RecordFailure(ctx context.Context, email, ip string) error {
+	now := time.Now()
+	attempt := models.LoginAttempt{
+		Email:         email,
+		IpAddress:     ip,
+		FailureCount:  1,
+		LastFailureAt: &now,
+	}
+
+	if _, err := r.db.ModelContext(ctx, &attempt).
+		OnConflict(`("email", "ip_address") DO UPDATE`).
+		Set(`"failure_count" = "login_attempt"."failure_count" + 1, "last_failure_at" = EXCLUDED.last_failure_at`).
+		Insert(); err != nil {
+		return err
+	}
+
+	if err := r.db.ModelContext(ctx, &attempt).
+		Where(`"login_attempt"."email" = ? AND "login_attempt"."ip_address" = ?`, email, ip).
+		Select(&attempt); err != nil {
+		return err
+	}
+
+	if attempt.FailureCount < r.policy.MaxFailures {
+		return nil
+	}
+
+	lockedUntil := now.Add(r.policy.LockDuration)
+	_, err := r.db.ModelContext(ctx, &attempt).
+		Set("locked_until = ?", lockedUntil).
+		Where(`"login_attempt"."email" = ? AND "login_attempt"."ip_address" = ?`, email, ip).
+		Update()
+	return err
+}
+
+// Reset clears a pair's failure history, e.g. after a successful login.
+func (r *RateLimiter) Reset(ctx context.Context, email, ip string) error {
+	_, err := r.db.ModelContext(ctx, (*models.LoginAttempt)(nil)).
+		Where(`"login_attempt"."email" = ? AND "login_attempt"."ip_address" = ?`, email, ip).
+		Delete()
+	return err
+}
+
+// backoff returns how long a pair must wait after its most recent failure
+// before another attempt is allowed: BaseDelay after the first failure,
+// doubling with every failure after that and capping at LockDuration.
+func (r *RateLimiter) backoff(failureCount int) time.Duration {
+	delay := r.policy.BaseDelay
+	for i := 1; i < failureCount && delay < r.policy.LockDuration; i++ {
+		delay *= 2
+	}
+	if delay > r.policy.LockDuration {
+		delay = r.policy.LockDuration
+	}
+	return delay
+}
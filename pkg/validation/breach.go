@@ -0,0 +1,73 @@
+package validation
+
+import (
+	"bufio"
+	"os"
+
+	"github.com/bits-and-blooms/bloom/v3"
+	"github.com/pkg/errors"
+)
+
+// breachFalsePositiveRate trades a small chance of rejecting a password
+// that was never actually breached for not having to ship or hold the full
+// plaintext list in memory.
+const breachFalsePositiveRate = 0.001
+
+// BreachList is a Bloom filter over a locally shipped list of known-breached
+// passwords (e.g. the HIBP top-N list). A positive match is treated as
+// breached; by construction a Bloom filter never false-negatives, so every
+// password actually on the list will always be caught.
+type BreachList struct {
+	filter *bloom.BloomFilter
+}
+
+// LoadBreachList reads a newline-delimited list of lowercase passwords from
+// path and builds a Bloom filter sized for it. An empty path is not an
+// error; it returns a nil BreachList, and Contains on a nil BreachList
+// always reports false, so the check is simply skipped.
+func LoadBreachList(path string) (*BreachList, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open breached password list")
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read breached password list")
+	}
+
+	filter := bloom.NewWithEstimates(uint(len(lines)), breachFalsePositiveRate)
+	for _, line := range lines {
+		filter.AddString(line)
+	}
+
+	return &BreachList{filter: filter}, nil
+}
+
+// Contains reports whether password appears in the breached password list.
+func (b *BreachList) Contains(password string) bool {
+	if b == nil {
+		return false
+	}
+
+	return b.filter.TestString(password)
+}
+
+// ValidateNotBreached returns an ErrorCodePasswordPwned error if list
+// contains password. list may be nil, in which case the check is skipped.
+func ValidateNotBreached(list *BreachList, password string) error {
+	if list.Contains(password) {
+		return newError(ErrorCodePasswordPwned, "password has appeared in a known data breach")
+	}
+
+	return nil
+}
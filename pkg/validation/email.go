@@ -0,0 +1,20 @@
+package validation
+
+import "regexp"
+
+// emailPattern is a pragmatic approximation of RFC 5322 covering the local
+// part and domain shapes real mail providers actually issue. It is meant to
+// reject obviously malformed input, not to be a complete grammar.
+var emailPattern = regexp.MustCompile(
+	`^[a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)+$`,
+)
+
+// ValidateEmail returns an ErrorCodeInvalidEmail error if email does not
+// look like a deliverable address.
+func ValidateEmail(email string) error {
+	if !emailPattern.MatchString(email) {
+		return newError(ErrorCodeInvalidEmail, "email address is not valid")
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package validation
+
+// ErrorCode is a stable, machine-readable identifier for a validation
+// failure. The frontend matches on this rather than parsing Message so it
+// can localize the text shown to the user.
+type ErrorCode string
+
+const (
+	ErrorCodeInvalidEmail    ErrorCode = "INVALID_EMAIL"
+	ErrorCodePasswordTooWeak ErrorCode = "PASSWORD_TOO_WEAK"
+	ErrorCodePasswordPwned   ErrorCode = "PASSWORD_PWNED"
+)
+
+// Error is returned by the functions in this package instead of a plain
+// error so callers can surface ErrorCode to API clients.
+type Error struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+func newError(code ErrorCode, message string) Error {
+	return Error{Code: code, Message: message}
+}
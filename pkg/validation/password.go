@@ -0,0 +1,40 @@
+package validation
+
+import (
+	"fmt"
+
+	"github.com/trustelem/zxcvbn"
+)
+
+// DefaultMinPasswordScore is used when Configuration.Validation does not
+// specify one. zxcvbn scores run 0 (trivially guessable) to 4 (very hard to
+// guess); 2 is the level zxcvbn itself documents as "safely unguessable".
+const DefaultMinPasswordScore = 2
+
+// MinPasswordLength is a hard floor independent of the entropy check below;
+// a long but still-guessable password (e.g. "aaaaaaaa") is still rejected
+// by the score check, but this keeps the error message useful for the
+// overwhelmingly common case of a password that's just too short.
+const MinPasswordLength = 8
+
+// PasswordPolicy bounds how strong a password has to be. MinScore maps
+// directly to zxcvbn's 0-4 score and is configurable per deployment.
+type PasswordPolicy struct {
+	MinScore int
+}
+
+// ValidatePassword checks password against policy, using email (and any
+// other known-to-the-user strings) as zxcvbn "user inputs" so a password
+// built from the user's own email doesn't score higher than it should.
+func ValidatePassword(policy PasswordPolicy, password string, userInputs ...string) error {
+	if len(password) < MinPasswordLength {
+		return newError(ErrorCodePasswordTooWeak, fmt.Sprintf("password must be at least %d characters", MinPasswordLength))
+	}
+
+	result := zxcvbn.PasswordStrength(password, userInputs)
+	if result.Score < policy.MinScore {
+		return newError(ErrorCodePasswordTooWeak, "password is too easy to guess")
+	}
+
+	return nil
+}